@@ -17,9 +17,6 @@ package indexers
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
-	"crypto/tls"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -28,53 +25,111 @@ import (
 	"sync"
 	"time"
 
-	elasticsearch "github.com/elastic/go-elasticsearch/v7"
-	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/cenkalti/backoff/v4"
 	log "github.com/sirupsen/logrus"
 )
 
-// Elastic ElasticSearch instance
+// Elastic ElasticSearch/OpenSearch instance. The concrete client used to
+// talk to the cluster is chosen at construction time based on the server
+// version/distribution reported by the cluster itself.
 type Elastic struct {
-	index string
+	index   string
+	dist    distribution
+	backend backend
+	mgmt    *managementClient
 }
 
-// ESClient elasticsearch client instance
-var ESClient *elasticsearch.Client
-
 // Returns new indexer for Elastic
 func NewElasticIndexer(indexerConfig IndexerConfig) (*Elastic, error) {
-	var err error
 	var esIndexer Elastic
 	if indexerConfig.Index == "" {
 		return &esIndexer, fmt.Errorf("index name not specified")
 	}
+	if len(indexerConfig.Servers) == 0 {
+		return &esIndexer, fmt.Errorf("no servers specified")
+	}
 	esIndex := strings.ToLower(indexerConfig.Index)
-	cfg := elasticsearch.Config{
-		Addresses: indexerConfig.Servers,
-		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: indexerConfig.InsecureSkipVerify}},
+
+	tlsConfig, err := newTLSConfig(indexerConfig)
+	if err != nil {
+		return &esIndexer, fmt.Errorf("configuring TLS: %w", err)
 	}
-	ESClient, err = elasticsearch.NewClient(cfg)
+	probeClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	dist, err := detectDistribution(indexerConfig.Servers[0], probeClient, indexerConfig.Username, indexerConfig.Password, indexerConfig.APIKey, indexerConfig.ServiceToken)
 	if err != nil {
-		return &esIndexer, fmt.Errorf("error creating the ES client: %s", err)
+		return &esIndexer, fmt.Errorf("detecting cluster version: %w", err)
 	}
-	r, err := ESClient.Cluster.Health()
+	log.Infof("Detected %s %d.x at %s", dist.name, dist.major, indexerConfig.Servers[0])
+
+	esBackend, err := newBackend(indexerConfig, dist)
 	if err != nil {
-		return &esIndexer, fmt.Errorf("ES health check failed: %s", err)
+		return &esIndexer, err
 	}
-	if r.StatusCode != 200 {
-		return &esIndexer, fmt.Errorf("unexpected ES status code: %d", r.StatusCode)
+	esIndexer.dist = dist
+	esIndexer.backend = esBackend
+	esIndexer.mgmt = newManagementClient(indexerConfig, probeClient)
+
+	ctx := context.Background()
+	if err := esBackend.clusterHealthy(ctx); err != nil {
+		return &esIndexer, err
 	}
 	esIndexer.index = esIndex
-	r, _ = ESClient.Indices.Exists([]string{esIndex})
-	if r.IsError() {
-		r, _ = ESClient.Indices.Create(esIndex)
-		if r.IsError() {
-			return &esIndexer, fmt.Errorf("error creating index %s on ES: %s", esIndex, r.String())
+
+	// ILM is an Elasticsearch-only feature; OpenSearch manages index
+	// lifecycle through ISM instead, so an ILM config set defensively on an
+	// OpenSearch cluster is ignored and indexing falls through to the
+	// normal single-index path below.
+	if indexerConfig.ILM != nil && dist.name != "opensearch" {
+		if err := ensureILM(esIndexer.mgmt, esIndex, *indexerConfig.ILM, indexerConfig.Mappings); err != nil {
+			return &esIndexer, err
+		}
+		aliasExists, err := esIndexer.mgmt.exists("/_alias/" + esIndex)
+		if err != nil {
+			return &esIndexer, fmt.Errorf("checking alias %s: %w", esIndex, err)
+		}
+		if !aliasExists {
+			return &esIndexer, fmt.Errorf("rollover alias %s was not created", esIndex)
+		}
+		return &esIndexer, nil
+	}
+
+	exists, err := esBackend.indexExists(ctx, esIndex)
+	if err != nil {
+		return &esIndexer, fmt.Errorf("checking index %s existence: %w", esIndex, err)
+	}
+	if !exists {
+		if err := esBackend.createIndex(ctx, esIndex, indexerConfig.Mappings); err != nil {
+			return &esIndexer, err
 		}
 	}
 	return &esIndexer, nil
 }
 
+// PutIndexTemplate registers or updates an index template on the cluster,
+// so indices matching its IndexPatterns inherit consistent field mappings
+// instead of relying on ES's type inference
+func (esIndexer *Elastic) PutIndexTemplate(name string, template IndexTemplate) error {
+	body := map[string]any{
+		"index_patterns": template.IndexPatterns,
+		"template": map[string]any{
+			"mappings": map[string]any{
+				"properties": template.Properties,
+			},
+		},
+	}
+	if template.Settings != nil {
+		body["template"].(map[string]any)["settings"] = template.Settings
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("encoding index template %s: %w", name, err)
+	}
+	if err := esIndexer.mgmt.put("/_index_template/"+name, payload); err != nil {
+		return fmt.Errorf("registering index template %s: %w", name, err)
+	}
+	return nil
+}
+
 // Index uses bulkIndexer to index the documents in the given index
 func (esIndexer *Elastic) Index(documents []interface{}, opts IndexingOpts) (string, error) {
 	var statString string
@@ -84,47 +139,71 @@ func (esIndexer *Elastic) Index(documents []interface{}, opts IndexingOpts) (str
 	if len(documents) <= 0 {
 		return fmt.Sprintf("Indexing skipped due to %v docs", len(documents)), nil
 	}
-	hasher := sha256.New()
-	bi, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
-		Client:     ESClient,
-		Index:      esIndexer.index,
-		FlushBytes: 5e+6,
-		NumWorkers: runtime.NumCPU(),
-		Timeout:    10 * time.Minute, // TODO: hardcoded
-	})
+	idStrategy := opts.IDStrategy
+	if idStrategy == nil {
+		idStrategy = SHA256Body{}
+	}
+	action := opts.Action
+	if action == "" {
+		action = ActionIndex
+	}
+	bi, err := esIndexer.backend.newBulkIndexer(esIndexer.index, 5e+6, runtime.NumCPU(), 10*time.Minute)
 	if err != nil {
 		return "", fmt.Errorf("Error creating the indexer: %s", err)
 	}
 	start := time.Now().UTC()
 	docHash := make(map[string]bool)
 	redundantSkipped := 0
+	var retryWG sync.WaitGroup
 	for _, document := range documents {
 		j, err := json.Marshal(document)
 		if err != nil {
 			return "", fmt.Errorf("Cannot encode document %v: %s", document, err)
 		}
 
-		hasher.Write(j)
-		docId := hex.EncodeToString(hasher.Sum(nil))
+		docId, err := idStrategy.GenerateID(document)
+		if err != nil {
+			return "", fmt.Errorf("Cannot generate ID for document %v: %s", document, err)
+		}
 		if _, exists := docHash[docId]; exists {
 			log.Debugf("Skipping redundant document with ID: %s", docId)
 			redundantSkipped++
 			continue
 		}
 
+		var targetIndex string
+		if opts.IndexResolver != nil {
+			targetIndex = opts.IndexResolver(document)
+		}
+
+		actionBody, err := buildActionBody(action, j)
+		if err != nil {
+			return "", fmt.Errorf("Cannot build %s action body for document %v: %s", action, document, err)
+		}
+
 		err = bi.Add(
 			context.Background(),
-			esutil.BulkIndexerItem{
-				Action:     "index",
-				Body:       bytes.NewReader(j),
+			bulkIndexerItem{
+				Action:     string(action),
+				Body:       actionBody,
 				DocumentID: docId,
-				OnSuccess: func(c context.Context, bii esutil.BulkIndexerItem, biri esutil.BulkIndexerResponseItem) {
+				Index:      targetIndex,
+				OnSuccess: func(result string) {
 					indexerStatsLock.Lock()
 					defer indexerStatsLock.Unlock()
-					indexerStats[biri.Result]++
+					indexerStats[result]++
 				},
-				OnFailure: func(c context.Context, bii esutil.BulkIndexerItem, biri esutil.BulkIndexerResponseItem, err error) {
-					log.Infof("Failed to index document with ID %s: %s, error: %v", bii.DocumentID, biri.Error.Reason, err)
+				OnFailure: func(reason string, statusCode int, err error) {
+					if opts.RetryConfig == nil || !isRetryableStatus(statusCode) {
+						log.Infof("Failed to index document with ID %s: %s, error: %v", docId, reason, err)
+						esIndexer.deadLetter(opts, docId, actionBody, reason, statusCode)
+						return
+					}
+					retryWG.Add(1)
+					go func(id string, body []byte) {
+						defer retryWG.Done()
+						esIndexer.retryDocument(opts, action, targetIndex, id, body, &indexerStatsLock, indexerStats)
+					}(docId, actionBody)
 				},
 			},
 		)
@@ -134,11 +213,11 @@ func (esIndexer *Elastic) Index(documents []interface{}, opts IndexingOpts) (str
 		}
 
 		docHash[docId] = true
-		hasher.Reset()
 	}
 	if err := bi.Close(context.Background()); err != nil {
 		return "", fmt.Errorf("Unexpected ES error: %s", err)
 	}
+	retryWG.Wait()
 	dur := time.Since(start)
 	for stat, val := range indexerStats {
 		statString += fmt.Sprintf(" %s=%d", stat, val)
@@ -148,3 +227,117 @@ func (esIndexer *Elastic) Index(documents []interface{}, opts IndexingOpts) (str
 	}
 	return fmt.Sprintf("Indexing finished in %v:%v", dur.Truncate(time.Millisecond), statString), nil
 }
+
+// newReader is a small helper shared by every backend's bulk indexer item
+// adapter to turn a marshalled document into the io.Reader their clients
+// expect
+func newReader(body []byte) *bytes.Reader {
+	return bytes.NewReader(body)
+}
+
+// buildActionBody wraps body in the envelope the bulk protocol expects for
+// action, e.g. {"doc": <body>} for update actions. index/create actions send
+// the marshalled document as-is.
+func buildActionBody(action Action, body []byte) ([]byte, error) {
+	if action != ActionUpdate {
+		return body, nil
+	}
+	wrapped, err := json.Marshal(map[string]json.RawMessage{"doc": body})
+	if err != nil {
+		return nil, fmt.Errorf("wrapping update body: %w", err)
+	}
+	return wrapped, nil
+}
+
+// isRetryableStatus reports whether a bulk response status indicates a
+// transient failure worth retrying (throttling or temporary unavailability)
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+}
+
+// retryDocument re-submits a single failed document with exponential
+// backoff, dead-lettering it if the retry budget in opts.RetryConfig is
+// exhausted
+func (esIndexer *Elastic) retryDocument(opts IndexingOpts, action Action, targetIndex string, docId string, body []byte, statsLock *sync.Mutex, stats map[string]int) {
+	var lastReason string
+	var lastStatus int
+
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = opts.RetryConfig.InitialInterval
+	b.MaxInterval = opts.RetryConfig.MaxInterval
+	b.Multiplier = opts.RetryConfig.Multiplier
+
+	attempt := func() error {
+		// Each attempt gets its own single-item bulk indexer rather than
+		// sharing one across retries: esutil only flushes on FlushBytes or
+		// its (default 30s) FlushInterval ticker, so a shared indexer would
+		// make every attempt wait out that tick instead of firing on
+		// RetryConfig's own backoff schedule. Close() forces an immediate
+		// flush, so OnSuccess/OnFailure fire before it returns.
+		bi, err := esIndexer.backend.newBulkIndexer(esIndexer.index, 5e+6, 1, 10*time.Minute)
+		if err != nil {
+			return err
+		}
+		done := make(chan error, 1)
+		err = bi.Add(context.Background(), bulkIndexerItem{
+			Action:     string(action),
+			Body:       body,
+			DocumentID: docId,
+			Index:      targetIndex,
+			OnSuccess: func(result string) {
+				statsLock.Lock()
+				stats[result]++
+				statsLock.Unlock()
+				done <- nil
+			},
+			OnFailure: func(reason string, statusCode int, err error) {
+				lastReason, lastStatus = reason, statusCode
+				if isRetryableStatus(statusCode) {
+					done <- fmt.Errorf("retryable failure for document %s: %s", docId, reason)
+				} else {
+					done <- backoff.Permanent(fmt.Errorf("permanent failure for document %s: %s", docId, reason))
+				}
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if err := bi.Close(context.Background()); err != nil {
+			return err
+		}
+		return <-done
+	}
+
+	// The document already failed once in the caller's bulk request, so
+	// every attempt here is a retry and waits out its backoff delay first.
+	bo := backoff.WithMaxRetries(b, uint64(opts.RetryConfig.MaxRetries))
+	bo.Reset()
+	var err error
+	for delay := bo.NextBackOff(); delay != backoff.Stop; delay = bo.NextBackOff() {
+		time.Sleep(delay)
+		if err = attempt(); err == nil {
+			return
+		}
+		if _, permanent := err.(*backoff.PermanentError); permanent {
+			break
+		}
+	}
+	log.Infof("Document %s exhausted retries: %v", docId, err)
+	esIndexer.deadLetter(opts, docId, body, lastReason, lastStatus)
+}
+
+// deadLetter hands a document that could not be indexed to the
+// caller-supplied DeadLetterSink, if any
+func (esIndexer *Elastic) deadLetter(opts IndexingOpts, docId string, body []byte, reason string, statusCode int) {
+	if opts.DeadLetterSink == nil {
+		return
+	}
+	if err := opts.DeadLetterSink.WriteFailedDoc(FailedDoc{
+		ID:         docId,
+		Body:       body,
+		Reason:     reason,
+		StatusCode: statusCode,
+	}); err != nil {
+		log.Infof("Error writing document %s to dead letter sink: %s", docId, err)
+	}
+}
@@ -0,0 +1,549 @@
+// Copyright 2023 The go-commons Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package indexers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	elasticv7 "github.com/elastic/go-elasticsearch/v7"
+	esapiv7 "github.com/elastic/go-elasticsearch/v7/esapi"
+	esutilv7 "github.com/elastic/go-elasticsearch/v7/esutil"
+	elasticv8 "github.com/elastic/go-elasticsearch/v8"
+	esapiv8 "github.com/elastic/go-elasticsearch/v8/esapi"
+	esutilv8 "github.com/elastic/go-elasticsearch/v8/esutil"
+	elasticv9 "github.com/elastic/go-elasticsearch/v9"
+	esapiv9 "github.com/elastic/go-elasticsearch/v9/esapi"
+	esutilv9 "github.com/elastic/go-elasticsearch/v9/esutil"
+	opensearch "github.com/opensearch-project/opensearch-go/v4"
+	"github.com/opensearch-project/opensearch-go/v4/opensearchapi"
+	opensearchutil "github.com/opensearch-project/opensearch-go/v4/opensearchutil"
+	log "github.com/sirupsen/logrus"
+)
+
+// distribution identifies the flavour and major version of the search
+// cluster an indexer is talking to
+type distribution struct {
+	// name is either "elasticsearch" or "opensearch"
+	name string
+	// major is the detected major server version, e.g. 7, 8, 9
+	major int
+}
+
+// backend abstracts the subset of client operations Elastic relies on, so
+// that the same indexing code path can target go-elasticsearch v7, v8, v9
+// or opensearch-go depending on what the remote cluster reports itself as.
+type backend interface {
+	clusterHealthy(ctx context.Context) error
+	indexExists(ctx context.Context, index string) (bool, error)
+	createIndex(ctx context.Context, index string, mappings json.RawMessage) error
+	newBulkIndexer(index string, flushBytes int, numWorkers int, timeout time.Duration) (bulkIndexer, error)
+}
+
+// bulkIndexer is the minimal surface of esutil.BulkIndexer that Index()
+// depends on, implemented separately per client major version
+type bulkIndexer interface {
+	Add(ctx context.Context, item bulkIndexerItem) error
+	Close(ctx context.Context) error
+}
+
+// bulkIndexerItem mirrors esutil.BulkIndexerItem across client versions
+type bulkIndexerItem struct {
+	Action     string
+	DocumentID string
+	// Index overrides the bulk indexer's default index for this item when
+	// non-empty, letting callers route documents per-document
+	Index     string
+	Body      []byte
+	OnSuccess func(result string)
+	OnFailure func(reason string, statusCode int, err error)
+}
+
+// detectDistribution dials the root endpoint of the cluster and classifies
+// it by the payload returned, matching the approach Kibana/Beats use to
+// tell Elasticsearch and OpenSearch apart.
+func detectDistribution(addr string, httpClient *http.Client, username, password, apiKey, serviceToken string) (distribution, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/", nil)
+	if err != nil {
+		return distribution{}, fmt.Errorf("building version probe request: %w", err)
+	}
+	switch {
+	case apiKey != "":
+		req.Header.Set("Authorization", "ApiKey "+apiKey)
+	case serviceToken != "":
+		req.Header.Set("Authorization", "Bearer "+serviceToken)
+	case username != "":
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return distribution{}, fmt.Errorf("probing cluster version: %w", err)
+	}
+	defer resp.Body.Close()
+	var info struct {
+		Version struct {
+			Number          string `json:"number"`
+			DistributionFor string `json:"distribution"`
+		} `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return distribution{}, fmt.Errorf("decoding version probe response: %w", err)
+	}
+	name := "elasticsearch"
+	if info.Version.DistributionFor == "opensearch" {
+		name = "opensearch"
+	}
+	major := 0
+	if parts := strings.SplitN(info.Version.Number, ".", 2); len(parts) > 0 {
+		major, _ = strconv.Atoi(parts[0])
+	}
+	return distribution{name: name, major: major}, nil
+}
+
+// newTLSConfig builds the tls.Config shared by every backend, honouring
+// InsecureSkipVerify and any caller-supplied CA certificates
+func newTLSConfig(indexerConfig IndexerConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: indexerConfig.InsecureSkipVerify}
+	if len(indexerConfig.CACerts) == 0 {
+		return tlsConfig, nil
+	}
+	pool := x509.NewCertPool()
+	for _, ca := range indexerConfig.CACerts {
+		if !pool.AppendCertsFromPEM([]byte(ca)) {
+			return nil, fmt.Errorf("failed to parse CA certificate")
+		}
+	}
+	tlsConfig.RootCAs = pool
+	return tlsConfig, nil
+}
+
+// newBackend builds the client implementation matching the detected
+// distribution, emitting a deprecation warning for clusters older than 7.x
+func newBackend(indexerConfig IndexerConfig, dist distribution) (backend, error) {
+	tlsConfig, err := newTLSConfig(indexerConfig)
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{TLSClientConfig: tlsConfig}
+
+	if dist.name != "opensearch" && dist.major < 7 {
+		log.Warnf("ES server version %d is deprecated and unsupported; please upgrade to 7.x or newer", dist.major)
+	}
+
+	if dist.name == "opensearch" {
+		return newOpenSearchBackend(indexerConfig, transport)
+	}
+
+	switch {
+	case dist.major >= 9:
+		return newV9Backend(indexerConfig, transport)
+	case dist.major == 8:
+		return newV8Backend(indexerConfig, transport)
+	default:
+		return newV7Backend(indexerConfig, transport)
+	}
+}
+
+type v7Backend struct {
+	client *elasticv7.Client
+}
+
+func newV7Backend(indexerConfig IndexerConfig, transport *http.Transport) (backend, error) {
+	client, err := elasticv7.NewClient(elasticv7.Config{
+		Addresses:    indexerConfig.Servers,
+		Username:     indexerConfig.Username,
+		Password:     indexerConfig.Password,
+		APIKey:       indexerConfig.APIKey,
+		ServiceToken: indexerConfig.ServiceToken,
+		Transport:    transport,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating go-elasticsearch v7 client: %w", err)
+	}
+	return &v7Backend{client: client}, nil
+}
+
+func (b *v7Backend) clusterHealthy(ctx context.Context) error {
+	r, err := b.client.Cluster.Health(b.client.Cluster.Health.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("ES health check failed: %w", err)
+	}
+	defer r.Body.Close()
+	if r.IsError() {
+		return fmt.Errorf("unexpected ES health status: %s", r.String())
+	}
+	return nil
+}
+
+func (b *v7Backend) indexExists(ctx context.Context, index string) (bool, error) {
+	r, err := b.client.Indices.Exists([]string{index}, b.client.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer r.Body.Close()
+	return !r.IsError(), nil
+}
+
+func (b *v7Backend) createIndex(ctx context.Context, index string, mappings json.RawMessage) error {
+	opts := []func(*esapiv7.IndicesCreateRequest){b.client.Indices.Create.WithContext(ctx)}
+	if len(mappings) > 0 {
+		opts = append(opts, b.client.Indices.Create.WithBody(bytes.NewReader(mappings)))
+	}
+	r, err := b.client.Indices.Create(index, opts...)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.IsError() {
+		return fmt.Errorf("error creating index %s on ES: %s", index, r.String())
+	}
+	return nil
+}
+
+func (b *v7Backend) newBulkIndexer(index string, flushBytes, numWorkers int, timeout time.Duration) (bulkIndexer, error) {
+	bi, err := esutilv7.NewBulkIndexer(esutilv7.BulkIndexerConfig{
+		Client:     b.client,
+		Index:      index,
+		FlushBytes: flushBytes,
+		NumWorkers: numWorkers,
+		Timeout:    timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &v7BulkIndexer{bi: bi}, nil
+}
+
+type v7BulkIndexer struct {
+	bi esutilv7.BulkIndexer
+}
+
+func (w *v7BulkIndexer) Add(ctx context.Context, item bulkIndexerItem) error {
+	return w.bi.Add(ctx, esutilv7.BulkIndexerItem{
+		Action:     item.Action,
+		DocumentID: item.DocumentID,
+		Index:      item.Index,
+		Body:       newReader(item.Body),
+		OnSuccess: func(c context.Context, bii esutilv7.BulkIndexerItem, biri esutilv7.BulkIndexerResponseItem) {
+			item.OnSuccess(biri.Result)
+		},
+		OnFailure: func(c context.Context, bii esutilv7.BulkIndexerItem, biri esutilv7.BulkIndexerResponseItem, err error) {
+			item.OnFailure(biri.Error.Reason, biri.Status, err)
+		},
+	})
+}
+
+func (w *v7BulkIndexer) Close(ctx context.Context) error {
+	return w.bi.Close(ctx)
+}
+
+// v8Backend and v9Backend target go-elasticsearch v8/v9. Despite the major
+// version bump, both still embed the same esapi.API surface v7 does
+// (functional-options request builders, not the newer fluent typed client),
+// so their implementations only differ from v7Backend in import path.
+
+type v8Backend struct {
+	client *elasticv8.Client
+}
+
+func newV8Backend(indexerConfig IndexerConfig, transport *http.Transport) (backend, error) {
+	client, err := elasticv8.NewClient(elasticv8.Config{
+		Addresses:    indexerConfig.Servers,
+		Username:     indexerConfig.Username,
+		Password:     indexerConfig.Password,
+		APIKey:       indexerConfig.APIKey,
+		ServiceToken: indexerConfig.ServiceToken,
+		Transport:    transport,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating go-elasticsearch v8 client: %w", err)
+	}
+	return &v8Backend{client: client}, nil
+}
+
+func (b *v8Backend) clusterHealthy(ctx context.Context) error {
+	r, err := b.client.Cluster.Health(b.client.Cluster.Health.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("ES health check failed: %w", err)
+	}
+	defer r.Body.Close()
+	if r.IsError() {
+		return fmt.Errorf("unexpected ES health status: %s", r.String())
+	}
+	return nil
+}
+
+func (b *v8Backend) indexExists(ctx context.Context, index string) (bool, error) {
+	r, err := b.client.Indices.Exists([]string{index}, b.client.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer r.Body.Close()
+	return !r.IsError(), nil
+}
+
+func (b *v8Backend) createIndex(ctx context.Context, index string, mappings json.RawMessage) error {
+	opts := []func(*esapiv8.IndicesCreateRequest){b.client.Indices.Create.WithContext(ctx)}
+	if len(mappings) > 0 {
+		opts = append(opts, b.client.Indices.Create.WithBody(bytes.NewReader(mappings)))
+	}
+	r, err := b.client.Indices.Create(index, opts...)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.IsError() {
+		return fmt.Errorf("error creating index %s on ES: %s", index, r.String())
+	}
+	return nil
+}
+
+func (b *v8Backend) newBulkIndexer(index string, flushBytes, numWorkers int, timeout time.Duration) (bulkIndexer, error) {
+	bi, err := esutilv8.NewBulkIndexer(esutilv8.BulkIndexerConfig{
+		Client:     b.client,
+		Index:      index,
+		FlushBytes: flushBytes,
+		NumWorkers: numWorkers,
+		Timeout:    timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &v8BulkIndexer{bi: bi}, nil
+}
+
+type v8BulkIndexer struct {
+	bi esutilv8.BulkIndexer
+}
+
+func (w *v8BulkIndexer) Add(ctx context.Context, item bulkIndexerItem) error {
+	return w.bi.Add(ctx, esutilv8.BulkIndexerItem{
+		Action:     item.Action,
+		DocumentID: item.DocumentID,
+		Index:      item.Index,
+		Body:       newReader(item.Body),
+		OnSuccess: func(c context.Context, bii esutilv8.BulkIndexerItem, biri esutilv8.BulkIndexerResponseItem) {
+			item.OnSuccess(biri.Result)
+		},
+		OnFailure: func(c context.Context, bii esutilv8.BulkIndexerItem, biri esutilv8.BulkIndexerResponseItem, err error) {
+			item.OnFailure(biri.Error.Reason, biri.Status, err)
+		},
+	})
+}
+
+func (w *v8BulkIndexer) Close(ctx context.Context) error {
+	return w.bi.Close(ctx)
+}
+
+type v9Backend struct {
+	client *elasticv9.Client
+}
+
+func newV9Backend(indexerConfig IndexerConfig, transport *http.Transport) (backend, error) {
+	client, err := elasticv9.NewClient(elasticv9.Config{
+		Addresses:    indexerConfig.Servers,
+		Username:     indexerConfig.Username,
+		Password:     indexerConfig.Password,
+		APIKey:       indexerConfig.APIKey,
+		ServiceToken: indexerConfig.ServiceToken,
+		Transport:    transport,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating go-elasticsearch v9 client: %w", err)
+	}
+	return &v9Backend{client: client}, nil
+}
+
+func (b *v9Backend) clusterHealthy(ctx context.Context) error {
+	r, err := b.client.Cluster.Health(b.client.Cluster.Health.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("ES health check failed: %w", err)
+	}
+	defer r.Body.Close()
+	if r.IsError() {
+		return fmt.Errorf("unexpected ES health status: %s", r.String())
+	}
+	return nil
+}
+
+func (b *v9Backend) indexExists(ctx context.Context, index string) (bool, error) {
+	r, err := b.client.Indices.Exists([]string{index}, b.client.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer r.Body.Close()
+	return !r.IsError(), nil
+}
+
+func (b *v9Backend) createIndex(ctx context.Context, index string, mappings json.RawMessage) error {
+	opts := []func(*esapiv9.IndicesCreateRequest){b.client.Indices.Create.WithContext(ctx)}
+	if len(mappings) > 0 {
+		opts = append(opts, b.client.Indices.Create.WithBody(bytes.NewReader(mappings)))
+	}
+	r, err := b.client.Indices.Create(index, opts...)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.IsError() {
+		return fmt.Errorf("error creating index %s on ES: %s", index, r.String())
+	}
+	return nil
+}
+
+func (b *v9Backend) newBulkIndexer(index string, flushBytes, numWorkers int, timeout time.Duration) (bulkIndexer, error) {
+	bi, err := esutilv9.NewBulkIndexer(esutilv9.BulkIndexerConfig{
+		Client:     b.client,
+		Index:      index,
+		FlushBytes: flushBytes,
+		NumWorkers: numWorkers,
+		Timeout:    timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &v9BulkIndexer{bi: bi}, nil
+}
+
+type v9BulkIndexer struct {
+	bi esutilv9.BulkIndexer
+}
+
+func (w *v9BulkIndexer) Add(ctx context.Context, item bulkIndexerItem) error {
+	return w.bi.Add(ctx, esutilv9.BulkIndexerItem{
+		Action:     item.Action,
+		DocumentID: item.DocumentID,
+		Index:      item.Index,
+		Body:       newReader(item.Body),
+		OnSuccess: func(c context.Context, bii esutilv9.BulkIndexerItem, biri esutilv9.BulkIndexerResponseItem) {
+			item.OnSuccess(biri.Result)
+		},
+		OnFailure: func(c context.Context, bii esutilv9.BulkIndexerItem, biri esutilv9.BulkIndexerResponseItem, err error) {
+			item.OnFailure(biri.Error.Reason, biri.Status, err)
+		},
+	})
+}
+
+func (w *v9BulkIndexer) Close(ctx context.Context) error {
+	return w.bi.Close(ctx)
+}
+
+// openSearchBackend targets opensearch-go v4. Unlike the elastic clients,
+// *opensearch.Client only carries the transport; the Cluster/Indices APIs
+// live on the separate *opensearchapi.Client built on top of it.
+type openSearchBackend struct {
+	client *opensearchapi.Client
+}
+
+func newOpenSearchBackend(indexerConfig IndexerConfig, transport *http.Transport) (backend, error) {
+	client, err := opensearchapi.NewClient(opensearchapi.Config{
+		Client: opensearch.Config{
+			Addresses: indexerConfig.Servers,
+			Username:  indexerConfig.Username,
+			Password:  indexerConfig.Password,
+			Transport: transport,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating opensearch-go client: %w", err)
+	}
+	return &openSearchBackend{client: client}, nil
+}
+
+func (b *openSearchBackend) clusterHealthy(ctx context.Context) error {
+	r, err := b.client.Cluster.Health(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("OpenSearch health check failed: %w", err)
+	}
+	defer r.Inspect().Response.Body.Close()
+	if r.Inspect().Response.IsError() {
+		return fmt.Errorf("unexpected OpenSearch health status: %s", r.Inspect().Response.Status())
+	}
+	return nil
+}
+
+func (b *openSearchBackend) indexExists(ctx context.Context, index string) (bool, error) {
+	r, err := b.client.Indices.Exists(ctx, opensearchapi.IndicesExistsReq{Indices: []string{index}})
+	if err != nil {
+		return false, err
+	}
+	defer r.Body.Close()
+	return !r.IsError(), nil
+}
+
+func (b *openSearchBackend) createIndex(ctx context.Context, index string, mappings json.RawMessage) error {
+	req := opensearchapi.IndicesCreateReq{Index: index}
+	if len(mappings) > 0 {
+		req.Body = bytes.NewReader(mappings)
+	}
+	r, err := b.client.Indices.Create(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer r.Inspect().Response.Body.Close()
+	if r.Inspect().Response.IsError() {
+		return fmt.Errorf("error creating index %s on OpenSearch: %s", index, r.Inspect().Response.Status())
+	}
+	return nil
+}
+
+func (b *openSearchBackend) newBulkIndexer(index string, flushBytes, numWorkers int, timeout time.Duration) (bulkIndexer, error) {
+	bi, err := opensearchutil.NewBulkIndexer(opensearchutil.BulkIndexerConfig{
+		Client:     b.client,
+		Index:      index,
+		FlushBytes: flushBytes,
+		NumWorkers: numWorkers,
+		Timeout:    timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &openSearchBulkIndexer{bi: bi}, nil
+}
+
+type openSearchBulkIndexer struct {
+	bi opensearchutil.BulkIndexer
+}
+
+func (w *openSearchBulkIndexer) Add(ctx context.Context, item bulkIndexerItem) error {
+	return w.bi.Add(ctx, opensearchutil.BulkIndexerItem{
+		Action:     item.Action,
+		DocumentID: item.DocumentID,
+		Index:      item.Index,
+		Body:       newReader(item.Body),
+		OnSuccess: func(c context.Context, bii opensearchutil.BulkIndexerItem, biri opensearchapi.BulkRespItem) {
+			item.OnSuccess(biri.Result)
+		},
+		OnFailure: func(c context.Context, bii opensearchutil.BulkIndexerItem, biri opensearchapi.BulkRespItem, err error) {
+			reason := ""
+			if biri.Error != nil {
+				reason = biri.Error.Reason
+			}
+			item.OnFailure(reason, biri.Status, err)
+		},
+	})
+}
+
+func (w *openSearchBulkIndexer) Close(ctx context.Context) error {
+	return w.bi.Close(ctx)
+}
@@ -0,0 +1,213 @@
+// Copyright 2023 The go-commons Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package indexers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// managementClient issues the raw index/cluster-management REST calls
+// (ILM policies, index templates, aliases) that are shaped identically
+// across Elasticsearch 7/8/9 and, for alias/template management, OpenSearch.
+type managementClient struct {
+	baseURL      string
+	httpClient   *http.Client
+	username     string
+	password     string
+	apiKey       string
+	serviceToken string
+}
+
+func newManagementClient(indexerConfig IndexerConfig, httpClient *http.Client) *managementClient {
+	return &managementClient{
+		baseURL:      strings.TrimRight(indexerConfig.Servers[0], "/"),
+		httpClient:   httpClient,
+		username:     indexerConfig.Username,
+		password:     indexerConfig.Password,
+		apiKey:       indexerConfig.APIKey,
+		serviceToken: indexerConfig.ServiceToken,
+	}
+}
+
+func (m *managementClient) do(method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, m.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	switch {
+	case m.apiKey != "":
+		req.Header.Set("Authorization", "ApiKey "+m.apiKey)
+	case m.serviceToken != "":
+		req.Header.Set("Authorization", "Bearer "+m.serviceToken)
+	case m.username != "":
+		req.SetBasicAuth(m.username, m.password)
+	}
+	return m.httpClient.Do(req)
+}
+
+func (m *managementClient) exists(path string) (bool, error) {
+	resp, err := m.do(http.MethodGet, path, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+func (m *managementClient) put(path string, body []byte) error {
+	resp, err := m.do(http.MethodPut, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("PUT %s failed with status %d: %s", path, resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// ensureILM provisions the ILM policy, index template and rollover alias
+// described by ilmConfig, creating the initial backing index if the alias
+// doesn't exist yet. mappings, when non-empty, is applied to the index
+// template so new indices created by rollover still get explicit field
+// mappings instead of relying on ES's type inference. Callers must not
+// invoke this on an OpenSearch cluster; OpenSearch manages index lifecycle
+// through ISM instead of ILM.
+func ensureILM(m *managementClient, alias string, ilmConfig ILMConfig, mappings json.RawMessage) error {
+	policy := map[string]any{
+		"policy": map[string]any{
+			"phases": ilmPhases(ilmConfig),
+		},
+	}
+	policyBody, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("encoding ILM policy: %w", err)
+	}
+	if err := m.put("/_ilm/policy/"+ilmConfig.PolicyName, policyBody); err != nil {
+		return fmt.Errorf("installing ILM policy %s: %w", ilmConfig.PolicyName, err)
+	}
+
+	templateDoc := map[string]any{
+		"settings": map[string]any{
+			"index.lifecycle.name":           ilmConfig.PolicyName,
+			"index.lifecycle.rollover_alias": alias,
+		},
+	}
+	indexMappings, err := extractMappings(mappings)
+	if err != nil {
+		return fmt.Errorf("decoding mappings for index template: %w", err)
+	}
+	if indexMappings != nil {
+		templateDoc["mappings"] = indexMappings
+	}
+	template := map[string]any{
+		"index_patterns": []string{alias + "-*"},
+		"template":       templateDoc,
+	}
+	templateBody, err := json.Marshal(template)
+	if err != nil {
+		return fmt.Errorf("encoding index template: %w", err)
+	}
+	if err := m.put("/_index_template/"+alias+"-template", templateBody); err != nil {
+		return fmt.Errorf("installing index template for %s: %w", alias, err)
+	}
+
+	aliasExists, err := m.exists("/_alias/" + alias)
+	if err != nil {
+		return fmt.Errorf("checking alias %s: %w", alias, err)
+	}
+	if aliasExists {
+		return nil
+	}
+	initialIndex := fmt.Sprintf("%s-000001", alias)
+	initBody, err := json.Marshal(map[string]any{
+		"aliases": map[string]any{
+			alias: map[string]any{"is_write_index": true},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("encoding initial index body: %w", err)
+	}
+	if err := m.put("/"+initialIndex, initBody); err != nil {
+		return fmt.Errorf("creating initial rollover index %s: %w", initialIndex, err)
+	}
+	return nil
+}
+
+// extractMappings decodes an IndexerConfig.Mappings body (the same raw
+// create-index request body createIndex sends for non-ILM indices) into the
+// value an index template's template.mappings expects. If mappings already
+// carries a top-level "mappings" key (as a create-index body would), that
+// nested value is used; otherwise the whole body is assumed to already be
+// the mappings object.
+func extractMappings(mappings json.RawMessage) (any, error) {
+	if len(mappings) == 0 {
+		return nil, nil
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(mappings, &body); err != nil {
+		return nil, err
+	}
+	raw, ok := body["mappings"]
+	if !ok {
+		raw = mappings
+	}
+	var decoded any
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+func ilmPhases(ilmConfig ILMConfig) map[string]any {
+	rolloverConditions := map[string]any{}
+	if ilmConfig.MaxAge != "" {
+		rolloverConditions["max_age"] = ilmConfig.MaxAge
+	}
+	if ilmConfig.MaxDocs > 0 {
+		rolloverConditions["max_docs"] = ilmConfig.MaxDocs
+	}
+	if ilmConfig.MaxSize != "" {
+		rolloverConditions["max_size"] = ilmConfig.MaxSize
+	}
+	phases := map[string]any{
+		"hot": map[string]any{
+			"actions": map[string]any{
+				"rollover": rolloverConditions,
+			},
+		},
+		"warm": map[string]any{
+			"actions": map[string]any{
+				"set_priority": map[string]any{"priority": 50},
+			},
+		},
+	}
+	if ilmConfig.DeleteAfter != "" {
+		phases["delete"] = map[string]any{
+			"min_age": ilmConfig.DeleteAfter,
+			"actions": map[string]any{
+				"delete": map[string]any{},
+			},
+		}
+	}
+	return phases
+}
@@ -0,0 +1,175 @@
+// Copyright 2023 The go-commons Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package indexers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	elasticv7 "github.com/elastic/go-elasticsearch/v7"
+)
+
+// newBulkTestServer fakes the `/_bulk` endpoint, failing each document with
+// a 429 for the first failN attempts before returning success, so retry
+// behaviour can be exercised without a real cluster.
+func newBulkTestServer(t *testing.T, failN int) (*httptest.Server, *sync.Mutex, map[string]int) {
+	t.Helper()
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// go-elasticsearch v7.14+ rejects responses lacking this header
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		if !strings.HasSuffix(r.URL.Path, "/_bulk") {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"version":{"number":"7.17.0"}}`))
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("reading bulk request body: %s", err)
+		}
+		lines := strings.Split(strings.TrimRight(string(body), "\n"), "\n")
+
+		hasErr := false
+		var items []map[string]map[string]any
+		for i := 0; i < len(lines); i += 2 {
+			var meta map[string]map[string]any
+			if err := json.Unmarshal([]byte(lines[i]), &meta); err != nil {
+				t.Fatalf("parsing bulk action line: %s", err)
+			}
+			var action, id string
+			for a, m := range meta {
+				action = a
+				if v, ok := m["_id"].(string); ok {
+					id = v
+				}
+			}
+
+			mu.Lock()
+			attempts[id]++
+			n := attempts[id]
+			mu.Unlock()
+
+			item := map[string]any{}
+			if n <= failN {
+				hasErr = true
+				item["status"] = http.StatusTooManyRequests
+				item["error"] = map[string]any{"type": "too_many_requests", "reason": "rejected execution"}
+			} else {
+				item["status"] = http.StatusCreated
+				item["result"] = "created"
+			}
+			items = append(items, map[string]map[string]any{action: item})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]any{
+			"took":   1,
+			"errors": hasErr,
+			"items":  items,
+		}); err != nil {
+			t.Fatalf("encoding bulk response: %s", err)
+		}
+	}))
+	return server, &mu, attempts
+}
+
+func newTestV7Backend(t *testing.T, serverURL string) backend {
+	t.Helper()
+	client, err := elasticv7.NewClient(elasticv7.Config{Addresses: []string{serverURL}})
+	if err != nil {
+		t.Fatalf("creating test ES client: %s", err)
+	}
+	return &v7Backend{client: client}
+}
+
+func retryOpts() IndexingOpts {
+	return IndexingOpts{
+		RetryConfig: &RetryConfig{
+			MaxRetries:      5,
+			InitialInterval: time.Millisecond,
+			MaxInterval:     5 * time.Millisecond,
+			Multiplier:      1.5,
+		},
+	}
+}
+
+func TestIndexRetriesOnThrottlingThenSucceeds(t *testing.T) {
+	server, mu, attempts := newBulkTestServer(t, 2)
+	defer server.Close()
+
+	esIndexer := &Elastic{index: "test-index", backend: newTestV7Backend(t, server.URL)}
+	docs := []interface{}{map[string]string{"value": "a"}}
+
+	if _, err := esIndexer.Index(docs, retryOpts()); err != nil {
+		t.Fatalf("Index returned unexpected error: %s", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(attempts) != 1 {
+		t.Fatalf("expected exactly one document to be submitted, got %d", len(attempts))
+	}
+	for id, n := range attempts {
+		if n != 3 {
+			t.Fatalf("document %s: expected 3 attempts (2 failures + 1 success), got %d", id, n)
+		}
+	}
+}
+
+func TestIndexDeadLettersAfterExhaustingRetries(t *testing.T) {
+	server, _, _ := newBulkTestServer(t, 100)
+	defer server.Close()
+
+	sink := &fakeDeadLetterSink{}
+	opts := retryOpts()
+	opts.RetryConfig.MaxRetries = 1
+	opts.DeadLetterSink = sink
+
+	esIndexer := &Elastic{index: "test-index", backend: newTestV7Backend(t, server.URL)}
+	docs := []interface{}{map[string]string{"value": "b"}}
+
+	if _, err := esIndexer.Index(docs, opts); err != nil {
+		t.Fatalf("Index returned unexpected error: %s", err)
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.failed) != 1 {
+		t.Fatalf("expected 1 document to be dead-lettered, got %d", len(sink.failed))
+	}
+	if sink.failed[0].StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected dead-lettered status 429, got %d", sink.failed[0].StatusCode)
+	}
+}
+
+type fakeDeadLetterSink struct {
+	mu     sync.Mutex
+	failed []FailedDoc
+}
+
+func (s *fakeDeadLetterSink) WriteFailedDoc(doc FailedDoc) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = append(s.failed, doc)
+	return nil
+}
@@ -0,0 +1,250 @@
+// Copyright 2023 The go-commons Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package indexers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IndexerConfig holds the configuration used to dial and authenticate
+// against the backend a given indexer talks to.
+type IndexerConfig struct {
+	// Servers list of addresses of the cluster to index documents to
+	Servers []string
+	// Index name of the default index/datastream documents are written to
+	Index string
+	// InsecureSkipVerify disables TLS certificate verification
+	InsecureSkipVerify bool
+	// Username for HTTP basic auth
+	Username string
+	// Password for HTTP basic auth
+	Password string
+	// APIKey, when set, is used instead of Username/Password
+	APIKey string
+	// CACerts is a list of PEM-encoded CA certificates to trust in addition
+	// to the system pool
+	CACerts []string
+	// ServiceToken for Elasticsearch/Kibana service account token auth
+	ServiceToken string
+	// ILM, when set, provisions a rollover alias, ILM policy and index
+	// template instead of a single concrete index
+	ILM *ILMConfig
+	// Mappings, when set, is sent as the body of the create-index request
+	// instead of letting the server infer field types from the first
+	// documents indexed
+	Mappings json.RawMessage
+}
+
+// ILMConfig describes the rollover alias, ILM policy and index template
+// NewElasticIndexer provisions for long-running indexers that would
+// otherwise accumulate unbounded data in a single index.
+type ILMConfig struct {
+	// PolicyName is the name the ILM policy is created/updated under
+	PolicyName string
+	// MaxAge rolls over the write index once it reaches this age, e.g. "7d"
+	MaxAge string
+	// MaxDocs rolls over the write index once it holds this many documents
+	MaxDocs int64
+	// MaxSize rolls over the write index once it reaches this size, e.g. "50gb"
+	MaxSize string
+	// DeleteAfter deletes indices once they reach this age, e.g. "30d"
+	DeleteAfter string
+}
+
+// IndexingOpts holds parameters that tune a single Index() call
+type IndexingOpts struct {
+	// RetryConfig, when set, enables exponential-backoff retries for
+	// documents that fail with a transient (429/503) response
+	RetryConfig *RetryConfig
+	// DeadLetterSink, when set, receives documents that exhausted their
+	// retry budget instead of being silently dropped
+	DeadLetterSink DeadLetterSink
+	// IDStrategy derives the document ID for each document; defaults to
+	// SHA256Body when nil
+	IDStrategy IDStrategy
+	// Action is the bulk operation requested for each document; defaults
+	// to ActionIndex when empty
+	Action Action
+	// IndexResolver, when set, routes each document to the index it
+	// returns instead of the indexer's default index, e.g. for
+	// time-series callers writing to daily/monthly indices
+	IndexResolver func(doc interface{}) string
+}
+
+// Action is the bulk operation requested for a document
+type Action string
+
+const (
+	// ActionIndex indexes the document, replacing any existing document
+	// with the same ID
+	ActionIndex Action = "index"
+	// ActionCreate indexes the document only if no document with the same
+	// ID already exists, failing otherwise
+	ActionCreate Action = "create"
+	// ActionUpdate partially updates an existing document, failing if it
+	// does not already exist
+	ActionUpdate Action = "update"
+)
+
+// IDStrategy derives the document ID used to index a document. Implementors
+// let callers control deduplication semantics across indexing runs.
+type IDStrategy interface {
+	GenerateID(doc interface{}) (string, error)
+}
+
+// SHA256Body derives the document ID from the SHA-256 hash of the
+// marshalled document body. This is the default strategy, but it is
+// sensitive to field reordering or any churning field (e.g. a timestamp).
+type SHA256Body struct{}
+
+// GenerateID implements IDStrategy
+func (SHA256Body) GenerateID(doc interface{}) (string, error) {
+	j, err := json.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("encoding document: %w", err)
+	}
+	sum := sha256.Sum256(j)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// FieldSet derives the document ID from only the named top-level JSON
+// fields, so changes to unrelated fields don't produce a new ID
+type FieldSet []string
+
+// GenerateID implements IDStrategy
+func (f FieldSet) GenerateID(doc interface{}) (string, error) {
+	j, err := json.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("encoding document: %w", err)
+	}
+	var generic map[string]json.RawMessage
+	if err := json.Unmarshal(j, &generic); err != nil {
+		return "", fmt.Errorf("FieldSet requires a JSON object document: %w", err)
+	}
+	hasher := sha256.New()
+	for _, field := range f {
+		hasher.Write([]byte(field))
+		hasher.Write(generic[field])
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// UUIDv4 assigns each document a random UUID, ignoring its content
+type UUIDv4 struct{}
+
+// GenerateID implements IDStrategy
+func (UUIDv4) GenerateID(doc interface{}) (string, error) {
+	return uuid.NewString(), nil
+}
+
+// Provided reads the document ID from the field tagged `es:"id"` on the
+// document struct
+type Provided struct{}
+
+// GenerateID implements IDStrategy
+func (Provided) GenerateID(doc interface{}) (string, error) {
+	v := reflect.ValueOf(doc)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return "", fmt.Errorf("Provided ID strategy requires a struct document, got %s", v.Kind())
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if tag, ok := t.Field(i).Tag.Lookup("es"); ok && tag == "id" {
+			return fmt.Sprintf("%v", v.Field(i).Interface()), nil
+		}
+	}
+	return "", fmt.Errorf("no field tagged `es:\"id\"` found on %T", doc)
+}
+
+// RetryConfig tunes the exponential-backoff retry policy applied to
+// documents that fail to index with a transient error
+type RetryConfig struct {
+	// MaxRetries is the maximum number of retry attempts per document
+	MaxRetries int
+	// InitialInterval is the backoff delay before the first retry
+	InitialInterval time.Duration
+	// MaxInterval caps the backoff delay between retries
+	MaxInterval time.Duration
+	// Multiplier grows the backoff delay between successive retries
+	Multiplier float64
+}
+
+// FailedDoc describes a document that could not be indexed after
+// exhausting its retry budget
+type FailedDoc struct {
+	ID         string
+	Body       []byte
+	Reason     string
+	StatusCode int
+}
+
+// DeadLetterSink receives documents dropped after exhausting retries, so
+// callers can persist them (to disk, S3, a queue, ...) and replay later
+type DeadLetterSink interface {
+	WriteFailedDoc(FailedDoc) error
+}
+
+// IndexTemplate describes an index template to register via
+// Elastic.PutIndexTemplate
+type IndexTemplate struct {
+	// IndexPatterns selects which index names this template applies to,
+	// e.g. []string{"metrics-*"}
+	IndexPatterns []string
+	// Properties maps field name to its mapping, as built by Keyword,
+	// Long, Date and Nested
+	Properties map[string]FieldMapping
+	// Settings is sent verbatim as the template's index settings
+	Settings map[string]any
+}
+
+// FieldMapping is a single field's mapping definition, as found under
+// mappings.properties.<field> in an index/template create request
+type FieldMapping map[string]any
+
+// Keyword builds a not-analyzed, exact-match string field mapping
+func Keyword() FieldMapping {
+	return FieldMapping{"type": "keyword"}
+}
+
+// Long builds a 64-bit integer field mapping
+func Long() FieldMapping {
+	return FieldMapping{"type": "long"}
+}
+
+// Date builds a date field mapping. format follows Elasticsearch's date
+// format syntax, e.g. "strict_date_optional_time||epoch_millis"; pass ""
+// to accept the server default.
+func Date(format string) FieldMapping {
+	m := FieldMapping{"type": "date"}
+	if format != "" {
+		m["format"] = format
+	}
+	return m
+}
+
+// Nested builds a nested field mapping out of the given sub-field mappings
+func Nested(properties map[string]FieldMapping) FieldMapping {
+	return FieldMapping{"type": "nested", "properties": properties}
+}